@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ddlDefs is an ordered, name-keyed view of the column or key/index clauses
+// inside a CREATE TABLE statement, so diffCreateTableAlterSQL can compare
+// two versions of a table clause-by-clause instead of treating the whole
+// statement as opaque text.
+type ddlDefs struct {
+	order []string
+	defs  map[string]string
+}
+
+func newDDLDefs() ddlDefs {
+	return ddlDefs{defs: make(map[string]string)}
+}
+
+func (d *ddlDefs) add(name, def string) {
+	if _, ok := d.defs[name]; !ok {
+		d.order = append(d.order, name)
+	}
+	d.defs[name] = def
+}
+
+var (
+	ddlColumnRe  = regexp.MustCompile("^`([^`]+)`\\s")
+	ddlKeyNameRe = regexp.MustCompile("(?i)^(?:UNIQUE\\s+)?(?:KEY|INDEX|CONSTRAINT|FOREIGN\\s+KEY)\\s+`([^`]+)`")
+)
+
+// extractCreateTableBody returns the text between a CREATE TABLE statement's
+// outermost parentheses, i.e. the column and key/index clause list.
+func extractCreateTableBody(createSQL string) (string, error) {
+	open := strings.Index(createSQL, "(")
+	if open < 0 {
+		return "", fmt.Errorf("no opening paren found in CREATE TABLE statement")
+	}
+	depth := 0
+	for i := open; i < len(createSQL); i++ {
+		switch createSQL[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return createSQL[open+1 : i], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no matching closing paren found in CREATE TABLE statement")
+}
+
+// splitTopLevel splits body on sep, ignoring any sep found inside nested
+// parentheses (e.g. the comma in `decimal(10,2)` or `enum('a','b')`).
+func splitTopLevel(body string, sep byte) []string {
+	var items []string
+	depth, start := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				items = append(items, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	items = append(items, body[start:])
+	return items
+}
+
+// keyName derives a stable identity for a key/index/constraint clause: the
+// literal "PRIMARY" for the primary key (MySQL allows only one), its quoted
+// name for named keys/constraints, or the full clause text as a last resort
+// for the rare anonymous FOREIGN KEY clause.
+func keyName(clause string) string {
+	if strings.HasPrefix(strings.ToUpper(clause), "PRIMARY KEY") {
+		return "PRIMARY"
+	}
+	if m := ddlKeyNameRe.FindStringSubmatch(clause); m != nil {
+		return m[1]
+	}
+	return clause
+}
+
+// dropKeyClause returns the ALTER TABLE clause that removes the key/index/
+// constraint identified by name, given the clause that originally added it.
+func dropKeyClause(name, clause string) string {
+	switch {
+	case name == "PRIMARY":
+		return "DROP PRIMARY KEY"
+	case strings.HasPrefix(strings.ToUpper(clause), "CONSTRAINT"):
+		return fmt.Sprintf("DROP FOREIGN KEY `%v`", name)
+	default:
+		return fmt.Sprintf("DROP INDEX `%v`", name)
+	}
+}
+
+// parseCreateTableDefs splits a CREATE TABLE statement's body into its
+// column definitions and its key/index/constraint clauses.
+func parseCreateTableDefs(createSQL string) (columns, keys ddlDefs, err error) {
+	body, err := extractCreateTableBody(createSQL)
+	if err != nil {
+		return ddlDefs{}, ddlDefs{}, err
+	}
+	columns, keys = newDDLDefs(), newDDLDefs()
+	for _, item := range splitTopLevel(body, ',') {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if m := ddlColumnRe.FindStringSubmatch(item); m != nil {
+			columns.add(m[1], item)
+			continue
+		}
+		keys.add(keyName(item), item)
+	}
+	return columns, keys, nil
+}
+
+// diffCreateTableAlterSQL returns the `ALTER TABLE` statement that takes a
+// table currently matching fromDDL to toDDL, by diffing their column and
+// key/index clauses, or "" if the two are equivalent. This replays a
+// targeted set of ADD/DROP/MODIFY COLUMN and ADD/DROP key clauses instead of
+// the `drop table` + recreate that would lose every row in the table.
+func diffCreateTableAlterSQL(db, table, fromDDL, toDDL string) (string, error) {
+	fromCols, fromKeys, err := parseCreateTableDefs(fromDDL)
+	if err != nil {
+		return "", fmt.Errorf("parse current schema of %v.%v error: %v", db, table, err)
+	}
+	toCols, toKeys, err := parseCreateTableDefs(toDDL)
+	if err != nil {
+		return "", fmt.Errorf("parse target schema of %v.%v error: %v", db, table, err)
+	}
+
+	var clauses []string
+	for _, name := range fromCols.order {
+		if _, ok := toCols.defs[name]; !ok {
+			clauses = append(clauses, fmt.Sprintf("DROP COLUMN `%v`", name))
+		}
+	}
+	for _, name := range toCols.order {
+		def, ok := fromCols.defs[name]
+		if !ok {
+			clauses = append(clauses, "ADD COLUMN "+toCols.defs[name])
+			continue
+		}
+		if def != toCols.defs[name] {
+			clauses = append(clauses, "MODIFY COLUMN "+toCols.defs[name])
+		}
+	}
+	for _, name := range fromKeys.order {
+		if _, ok := toKeys.defs[name]; !ok {
+			clauses = append(clauses, dropKeyClause(name, fromKeys.defs[name]))
+		}
+	}
+	for _, name := range toKeys.order {
+		def, ok := fromKeys.defs[name]
+		if !ok {
+			clauses = append(clauses, "ADD "+toKeys.defs[name])
+			continue
+		}
+		if def != toKeys.defs[name] {
+			clauses = append(clauses, dropKeyClause(name, fromKeys.defs[name]), "ADD "+toKeys.defs[name])
+		}
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("ALTER TABLE `%v`.`%v` %v;", db, table, strings.Join(clauses, ", ")), nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import "testing"
+
+func TestDiffCreateTableAlterSQLAddsAndDropsColumns(t *testing.T) {
+	from := "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  `name` varchar(64) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n)"
+	to := "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  `age` int(11) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n)"
+
+	sql, err := diffCreateTableAlterSQL("db", "t", from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "ALTER TABLE `db`.`t` DROP COLUMN `name`, ADD COLUMN `age` int(11) DEFAULT NULL;"
+	if sql != want {
+		t.Fatalf("got %q, want %q", sql, want)
+	}
+}
+
+func TestDiffCreateTableAlterSQLModifiesColumn(t *testing.T) {
+	from := "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  `name` varchar(64) DEFAULT NULL\n)"
+	to := "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  `name` varchar(128) DEFAULT NULL\n)"
+
+	sql, err := diffCreateTableAlterSQL("db", "t", from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "ALTER TABLE `db`.`t` MODIFY COLUMN `name` varchar(128) DEFAULT NULL;"
+	if sql != want {
+		t.Fatalf("got %q, want %q", sql, want)
+	}
+}
+
+func TestDiffCreateTableAlterSQLAddsAndDropsKeys(t *testing.T) {
+	from := "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  `email` varchar(64) DEFAULT NULL,\n  KEY `idx_email` (`email`)\n)"
+	to := "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  `email` varchar(64) DEFAULT NULL,\n  UNIQUE KEY `idx_email_unique` (`email`)\n)"
+
+	sql, err := diffCreateTableAlterSQL("db", "t", from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "ALTER TABLE `db`.`t` DROP INDEX `idx_email`, ADD UNIQUE KEY `idx_email_unique` (`email`);"
+	if sql != want {
+		t.Fatalf("got %q, want %q", sql, want)
+	}
+}
+
+func TestDiffCreateTableAlterSQLNoopWhenEquivalent(t *testing.T) {
+	ddl := "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  PRIMARY KEY (`id`)\n)"
+
+	sql, err := diffCreateTableAlterSQL("db", "t", ddl, ddl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sql != "" {
+		t.Fatalf("expected no-op diff to produce empty SQL, got %q", sql)
+	}
+}
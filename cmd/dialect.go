@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	// registers the "postgres" sql.DB driver.
+	_ "github.com/lib/pq"
+)
+
+// Dialect abstracts the handful of operations that differ between the
+// database engines transport/migrate can talk to, so exportDBSchemas,
+// importSchemas and friends don't need to branch on driver name directly.
+type Dialect interface {
+	// Quote wraps an identifier (database, table or column name) in the
+	// dialect's quoting style.
+	Quote(identifier string) string
+	// CreateDatabaseIfNotExists creates dbName if the dialect supports
+	// namespacing tables by database (a no-op returning nil otherwise).
+	CreateDatabaseIfNotExists(db *sql.DB, dbName string) error
+	// ListTables returns the base tables of dbName. postgresDialect reads
+	// the database db is connected to, so callers pass a connection from
+	// perDBHandler.
+	ListTables(db *sql.DB, dbName string) ([]string, error)
+	// ShowCreateTable returns a CREATE TABLE statement for dbName.table,
+	// synthesized from information_schema where the engine has no native
+	// "show create table". Like ListTables, postgresDialect reads the
+	// database db is connected to.
+	ShowCreateTable(db *sql.DB, dbName, table string) (string, error)
+	// TranslateCreateTable rewrites a MySQL/TiDB flavored CREATE TABLE
+	// statement (backtick quoting, AUTO_INCREMENT, UNSIGNED, TiDB storage
+	// clauses) into this dialect's equivalent. Dialects that namespace tables
+	// by database on one connection (mysqlDialect) qualify the table name
+	// with dbName so the statement doesn't depend on the connection's
+	// current database, and otherwise only need to qualify. postgresDialect
+	// ignores dbName: the statement runs on a connection to dbName itself
+	// (see perDBHandler).
+	TranslateCreateTable(dbName, mysqlDDL string) (string, error)
+	// LoadStats loads a dumped stats file into dbName.table. Dialects with
+	// no optimizer statistics format of their own return an error.
+	LoadStats(h *tidbHandler, dbName, table, path string) error
+	// SupportsMigrations reports whether the `migrate` subcommand's
+	// schema_migrations bookkeeping (ensureMigrationsTable/getMigrationState/
+	// setMigrationState), which is hardcoded MySQL/TiDB DDL and DML, can run
+	// against this dialect.
+	SupportsMigrations() bool
+}
+
+// buildPostgresDSN turns a tidbAccessOptions into a lib/pq keyword/value
+// connection string. Unlike MySQL, sslmode has no shared registry to point
+// at, so --tls-ca/--tls-cert/--tls-key are passed through as file paths
+// directly, which is what lib/pq expects.
+func buildPostgresDSN(opt tidbAccessOptions, defaultDB string) string {
+	if opt.dsn != "" {
+		return opt.dsn
+	}
+	defaultDB = strings.TrimSpace(defaultDB)
+	if defaultDB == "" {
+		defaultDB = "postgres"
+	}
+	timeout := opt.connTimeout
+	if timeout == 0 {
+		timeout = defaultConnTimeout
+	}
+	sslmode := opt.tls
+	if sslmode == "" {
+		sslmode = "disable"
+	}
+	parts := []string{
+		fmt.Sprintf("host=%s", opt.addr),
+		fmt.Sprintf("port=%s", opt.port),
+		fmt.Sprintf("user=%s", opt.user),
+		fmt.Sprintf("dbname=%s", defaultDB),
+		fmt.Sprintf("sslmode=%s", sslmode),
+		fmt.Sprintf("connect_timeout=%d", int(timeout.Seconds())),
+	}
+	if opt.password != "" {
+		parts = append(parts, fmt.Sprintf("password=%s", opt.password))
+	}
+	if opt.tlsCA != "" {
+		parts = append(parts, fmt.Sprintf("sslrootcert=%s", opt.tlsCA))
+	}
+	if opt.tlsCert != "" {
+		parts = append(parts, fmt.Sprintf("sslcert=%s", opt.tlsCert))
+	}
+	if opt.tlsKey != "" {
+		parts = append(parts, fmt.Sprintf("sslkey=%s", opt.tlsKey))
+	}
+	return strings.Join(parts, " ")
+}
+
+func dialectForDriver(driver string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(driver)) {
+	case "", "tidb", "mysql":
+		return mysqlDialect{}, nil
+	case "postgres", "postgresql", "cockroachdb", "crdb":
+		return postgresDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported driver: %v", driver)
+	}
+}
+
+// mysqlDialect drives TiDB and MySQL, which already support everything
+// transport needs natively.
+type mysqlDialect struct{}
+
+func (mysqlDialect) Quote(identifier string) string {
+	return fmt.Sprintf("`%v`", identifier)
+}
+
+func (mysqlDialect) CreateDatabaseIfNotExists(db *sql.DB, dbName string) error {
+	_, err := db.Exec(fmt.Sprintf("create database if not exists `%v`", dbName))
+	if err != nil {
+		return fmt.Errorf("create DB: %v error: %v", dbName, err)
+	}
+	return nil
+}
+
+func (mysqlDialect) ListTables(db *sql.DB, dbName string) ([]string, error) {
+	if _, err := db.Exec("use " + dbName); err != nil {
+		return nil, fmt.Errorf("switch to DB: %v error: %v", dbName, err)
+	}
+	rows, err := db.Query("show tables")
+	if err != nil {
+		return nil, fmt.Errorf("execute show tables error: %v", err)
+	}
+	defer rows.Close()
+	tables := make([]string, 0, 8)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("scan rows error: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func (mysqlDialect) ShowCreateTable(db *sql.DB, dbName, table string) (string, error) {
+	rows, err := db.Query(fmt.Sprintf("show create table `%v`.`%v`", dbName, table))
+	if err != nil {
+		return "", fmt.Errorf("show create table `%v`.`%v` error: %v", dbName, table, err)
+	}
+	defer rows.Close()
+	rows.Next()
+	var name, createSQL string
+	if err := rows.Scan(&name, &createSQL); err != nil {
+		return "", fmt.Errorf("scan show create table result error: %v", err)
+	}
+	return createSQL, nil
+}
+
+// mysqlCreateTableNameRe matches the backtick-quoted table name in a `show
+// create table` result, so TranslateCreateTable can qualify it with the
+// destination database instead of relying on a prior `use db` having landed
+// on the same pooled connection that runs this statement.
+var mysqlCreateTableNameRe = regexp.MustCompile("(?i)^CREATE TABLE `([^`]+)`")
+
+func (mysqlDialect) TranslateCreateTable(dbName, mysqlDDL string) (string, error) {
+	if !mysqlCreateTableNameRe.MatchString(mysqlDDL) {
+		return "", fmt.Errorf("cannot find table name to qualify with database %v in DDL: %v", dbName, mysqlDDL)
+	}
+	return mysqlCreateTableNameRe.ReplaceAllString(mysqlDDL, fmt.Sprintf("CREATE TABLE `%s`.`$1`", dbName)), nil
+}
+
+func (mysqlDialect) LoadStats(h *tidbHandler, dbName, table, path string) error {
+	return loadStatsFile(h, path)
+}
+
+func (mysqlDialect) SupportsMigrations() bool {
+	return true
+}
+
+// postgresDialect talks to PostgreSQL and CockroachDB, which have no "show
+// create table" and no concept of TiDB-style optimizer stats dumps, so
+// schemas are synthesized from information_schema and stats loading is
+// unsupported.
+type postgresDialect struct{}
+
+func (postgresDialect) Quote(identifier string) string {
+	return fmt.Sprintf("%q", identifier)
+}
+
+func (postgresDialect) CreateDatabaseIfNotExists(db *sql.DB, dbName string) error {
+	var exists bool
+	err := db.QueryRow("select exists (select 1 from pg_database where datname = $1)", dbName).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check database %v existence error: %v", dbName, err)
+	}
+	if exists {
+		return nil
+	}
+	if _, err := db.Exec(fmt.Sprintf("create database %q", dbName)); err != nil {
+		return fmt.Errorf("create DB: %v error: %v", dbName, err)
+	}
+	return nil
+}
+
+func (postgresDialect) ListTables(db *sql.DB, dbName string) ([]string, error) {
+	rows, err := db.Query(
+		"select table_name from information_schema.tables where table_schema = 'public' and table_type = 'BASE TABLE'")
+	if err != nil {
+		return nil, fmt.Errorf("list tables in DB: %v error: %v", dbName, err)
+	}
+	defer rows.Close()
+	tables := make([]string, 0, 8)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("scan rows error: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func (d postgresDialect) ShowCreateTable(db *sql.DB, dbName, table string) (string, error) {
+	rows, err := db.Query(
+		`select column_name, data_type, is_nullable, column_default
+		 from information_schema.columns
+		 where table_schema = 'public' and table_name = $1
+		 order by ordinal_position`, table)
+	if err != nil {
+		return "", fmt.Errorf("read columns of %v.%v error: %v", dbName, table, err)
+	}
+	defer rows.Close()
+
+	cols := make([]string, 0, 8)
+	for rows.Next() {
+		var name, dataType, nullable string
+		var def sql.NullString
+		if err := rows.Scan(&name, &dataType, &nullable, &def); err != nil {
+			return "", fmt.Errorf("scan column of %v.%v error: %v", dbName, table, err)
+		}
+		col := fmt.Sprintf("%s %s", d.Quote(name), dataType)
+		if nullable == "NO" {
+			col += " NOT NULL"
+		}
+		if def.Valid {
+			col += " DEFAULT " + def.String
+		}
+		cols = append(cols, "\t"+col)
+	}
+	if len(cols) == 0 {
+		return "", fmt.Errorf("table %v.%v not found", dbName, table)
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n)", d.Quote(table), strings.Join(cols, ",\n")), nil
+}
+
+func (postgresDialect) TranslateCreateTable(_, mysqlDDL string) (string, error) {
+	return translateMySQLCreateTableToPostgres(mysqlDDL)
+}
+
+func (postgresDialect) LoadStats(h *tidbHandler, dbName, table, path string) error {
+	return fmt.Errorf("postgres/cockroachdb has no TiDB-style stats format, cannot load %v into %v.%v", path, dbName, table)
+}
+
+func (postgresDialect) SupportsMigrations() bool {
+	return false
+}
+
+var (
+	backtickRe       = regexp.MustCompile("`([^`]*)`")
+	autoIncrementRe  = regexp.MustCompile(`(?i)\s*AUTO_INCREMENT(=\d+)?`)
+	unsignedRe       = regexp.MustCompile(`(?i)\s*UNSIGNED`)
+	tidbStorageRe    = regexp.MustCompile(`(?i)\)\s*ENGINE=\S+.*$`)
+	tidbIntDisplayRe = regexp.MustCompile(`(?i)\b(int|bigint|tinyint|smallint|mediumint)\(\d+\)`)
+)
+
+// translateMySQLCreateTableToPostgres rewrites a handful of MySQL/TiDB-only
+// syntax elements so a `show create table` dump from mysqlDialect can be
+// replayed against Postgres: backtick quoting becomes double quotes,
+// AUTO_INCREMENT/UNSIGNED/display-width annotations are dropped, and the
+// trailing ENGINE=.../TiDB storage clause is cut off.
+func translateMySQLCreateTableToPostgres(mysqlDDL string) (string, error) {
+	ddl := tidbStorageRe.ReplaceAllString(mysqlDDL, ")")
+	ddl = autoIncrementRe.ReplaceAllString(ddl, "")
+	ddl = unsignedRe.ReplaceAllString(ddl, "")
+	ddl = tidbIntDisplayRe.ReplaceAllString(ddl, "$1")
+	ddl = backtickRe.ReplaceAllString(ddl, `"$1"`)
+	return ddl, nil
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import "testing"
+
+func TestTranslateMySQLCreateTableToPostgres(t *testing.T) {
+	mysqlDDL := "CREATE TABLE `t1` (\n" +
+		"  `id` bigint(20) NOT NULL AUTO_INCREMENT,\n" +
+		"  `cnt` int(11) unsigned DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+	got, err := translateMySQLCreateTableToPostgres(mysqlDDL)
+	if err != nil {
+		t.Fatalf("translateMySQLCreateTableToPostgres() error: %v", err)
+	}
+	want := "CREATE TABLE \"t1\" (\n" +
+		"  \"id\" bigint NOT NULL,\n" +
+		"  \"cnt\" int DEFAULT NULL,\n" +
+		"  PRIMARY KEY (\"id\")\n" +
+		")"
+	if got != want {
+		t.Fatalf("translateMySQLCreateTableToPostgres() = %q, want %q", got, want)
+	}
+}
+
+func TestMySQLDialectTranslateCreateTableQualifiesDatabase(t *testing.T) {
+	ddl := "CREATE TABLE `t1` (\n  `id` bigint(20) NOT NULL\n) ENGINE=InnoDB"
+	got, err := (mysqlDialect{}).TranslateCreateTable("mydb", ddl)
+	if err != nil {
+		t.Fatalf("TranslateCreateTable() error: %v", err)
+	}
+	want := "CREATE TABLE `mydb`.`t1` (\n  `id` bigint(20) NOT NULL\n) ENGINE=InnoDB"
+	if got != want {
+		t.Fatalf("TranslateCreateTable() = %q, want %q", got, want)
+	}
+}
+
+func TestMySQLDialectTranslateCreateTableRejectsUnrecognizedDDL(t *testing.T) {
+	if _, err := (mysqlDialect{}).TranslateCreateTable("mydb", "not a create table statement"); err == nil {
+		t.Fatal("expected an error for a DDL string with no table name to qualify")
+	}
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestEntry records what was captured for a single table, so a later
+// run against the same directory can tell whether it already has a good
+// copy of that table's schema/stats without re-downloading them.
+type manifestEntry struct {
+	Addr         string    `json:"addr"`
+	DB           string    `json:"db"`
+	Table        string    `json:"table"`
+	SchemaSHA256 string    `json:"schema_sha256,omitempty"`
+	StatsSHA256  string    `json:"stats_sha256,omitempty"`
+	StatsBytes   int64     `json:"stats_bytes,omitempty"`
+	ExportedAt   time.Time `json:"exported_at"`
+}
+
+// manifestFile is the in-memory, concurrency-safe view of manifest.json:
+// one entry per db.table, keyed by "db.table".
+type manifestFile struct {
+	mu      sync.Mutex
+	entries map[string]manifestEntry
+}
+
+func manifestPath(dir string) string {
+	return filepath.Join(dir, "manifest.json")
+}
+
+func manifestKey(db, table string) string {
+	return db + "." + table
+}
+
+func loadManifest(dir string) (*manifestFile, error) {
+	m := &manifestFile{entries: make(map[string]manifestEntry)}
+	content, err := ioutil.ReadFile(manifestPath(dir))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest %v error: %v", manifestPath(dir), err)
+	}
+	entries := make([]manifestEntry, 0)
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("unmarshal manifest %v error: %v", manifestPath(dir), err)
+	}
+	for _, e := range entries {
+		m.entries[manifestKey(e.DB, e.Table)] = e
+	}
+	return m, nil
+}
+
+func (m *manifestFile) get(db, table string) (manifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[manifestKey(db, table)]
+	return e, ok
+}
+
+// update merges fn's changes into the entry for db.table and stamps
+// ExportedAt, creating the entry if this is the first time db.table is seen.
+func (m *manifestFile) update(db, table string, fn func(e *manifestEntry)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := manifestKey(db, table)
+	e := m.entries[key]
+	e.DB, e.Table = db, table
+	fn(&e)
+	e.ExportedAt = time.Now()
+	m.entries[key] = e
+}
+
+func (m *manifestFile) save(dir string) error {
+	m.mu.Lock()
+	entries := make([]manifestEntry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	m.mu.Unlock()
+
+	jsonData, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(manifestPath(dir), jsonData, 0666); err != nil {
+		return err
+	}
+	return nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256File(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return sha256Hex(content), nil
+}
+
+// verifyDirAgainstSource checks dir's manifest.json against what h's source
+// currently has, without writing anything: a table with no manifest entry,
+// whose schema hash differs from the live source, or whose stats file is
+// missing or does not match its manifest hash, is reported. Stats files are
+// not compared against the live source.
+func verifyDirAgainstSource(h *tidbHandler, dbs []string, dir string, tablesMap, ignoreTables map[string]struct{}) error {
+	m, err := loadManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	mismatches := 0
+	for _, db := range dbs {
+		dh, closeDH, err := perDBHandler(h, db)
+		if err != nil {
+			return err
+		}
+		defer closeDH()
+		tables, err := getTables(dh, db)
+		if err != nil {
+			return fmt.Errorf("get DB: %v table information error: %v", db, err)
+		}
+		for _, t := range tables {
+			if _, ok := ignoreTables[strings.ToLower(t)]; ok {
+				continue
+			}
+			if len(tablesMap) > 0 {
+				if _, ok := tablesMap[strings.ToLower(t)]; !ok {
+					continue
+				}
+			}
+
+			entry, ok := m.get(db, t)
+			if !ok {
+				fmt.Printf("MISSING: %v.%v has no manifest entry in %v\n", db, t, dir)
+				mismatches++
+				continue
+			}
+			createSQL, err := dh.dialect.ShowCreateTable(dh.db, db, t)
+			if err != nil {
+				return err
+			}
+			if sha256Hex([]byte(createSQL)) != entry.SchemaSHA256 {
+				fmt.Printf("STALE: %v.%v schema in %v differs from the live source\n", db, t, dir)
+				mismatches++
+				continue
+			}
+			if entry.StatsSHA256 != "" {
+				hash, err := sha256File(statsPath(db, t, dir))
+				if err != nil {
+					fmt.Printf("MISSING: %v.%v stats file error: %v\n", db, t, err)
+					mismatches++
+					continue
+				}
+				if hash != entry.StatsSHA256 {
+					fmt.Printf("CORRUPT: %v.%v stats file in %v does not match its manifest hash\n", db, t, dir)
+					mismatches++
+				}
+			}
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%v table(s) in %v are missing or out of date, see above", mismatches, dir)
+	}
+	fmt.Printf("%v matches the live source\n", dir)
+	return nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import "testing"
+
+func TestManifestFileGetUpdate(t *testing.T) {
+	m := &manifestFile{entries: make(map[string]manifestEntry)}
+
+	if _, ok := m.get("d1", "t1"); ok {
+		t.Fatal("get() on an empty manifest should miss")
+	}
+
+	m.update("d1", "t1", func(e *manifestEntry) {
+		e.Addr = "127.0.0.1"
+		e.SchemaSHA256 = sha256Hex([]byte("create table t1 (id int)"))
+	})
+
+	entry, ok := m.get("d1", "t1")
+	if !ok {
+		t.Fatal("get() should find the entry just written by update()")
+	}
+	if entry.ExportedAt.IsZero() {
+		t.Fatal("update() should stamp ExportedAt")
+	}
+
+	// A schema hash comparison, as used by exportDBSchemas to decide
+	// whether a cached schema file is still current, should match the
+	// hash of the exact bytes that were hashed into the entry and miss
+	// on anything else.
+	if sha256Hex([]byte("create table t1 (id int)")) != entry.SchemaSHA256 {
+		t.Fatal("hash of the original schema bytes should match the stored SchemaSHA256")
+	}
+	if sha256Hex([]byte("create table t1 (id bigint)")) == entry.SchemaSHA256 {
+		t.Fatal("hash of a changed schema should not match the stored SchemaSHA256")
+	}
+}
+
+func TestManifestFileDistinguishesTablesAcrossDatabases(t *testing.T) {
+	m := &manifestFile{entries: make(map[string]manifestEntry)}
+	m.update("d1", "t1", func(e *manifestEntry) { e.SchemaSHA256 = "aaa" })
+	m.update("d2", "t1", func(e *manifestEntry) { e.SchemaSHA256 = "bbb" })
+
+	e1, ok := m.get("d1", "t1")
+	if !ok || e1.SchemaSHA256 != "aaa" {
+		t.Fatalf("get(d1, t1) = %+v, %v, want SchemaSHA256 aaa", e1, ok)
+	}
+	e2, ok := m.get("d2", "t1")
+	if !ok || e2.SchemaSHA256 != "bbb" {
+		t.Fatalf("get(d2, t1) = %+v, %v, want SchemaSHA256 bbb", e2, ok)
+	}
+}
@@ -0,0 +1,397 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// migration describes a single numbered schema change, loaded from a pair
+// of NNN_<name>.up.sql / NNN_<name>.down.sql files under dir/migrations/<db>.
+type migration struct {
+	version  int64
+	name     string
+	upPath   string
+	downPath string
+}
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type migrateOptions struct {
+	dst tidbAccessOptions
+	dir string
+	dbs []string
+}
+
+func newMigrateCmd() *cobra.Command {
+	var opt migrateOptions
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "apply versioned schema migrations generated from exported schemas",
+		Long:  `apply versioned schema migrations generated from exported schemas`,
+	}
+	cmd.PersistentFlags().StringVar(&opt.dst.addr, "dstaddr", "", "")
+	cmd.PersistentFlags().StringVar(&opt.dst.port, "dstport", "4000", "")
+	cmd.PersistentFlags().StringVar(&opt.dst.user, "dstuser", "", "")
+	cmd.PersistentFlags().StringVar(&opt.dst.password, "dstpassword", "", "")
+	registerAccessFlags(cmd, &opt.dst, "dst")
+	cmd.PersistentFlags().StringVar(&opt.dir, "dir", "", "directory holding migration files, see migration-plan.json")
+	cmd.PersistentFlags().StringSliceVar(&opt.dbs, "dbs", nil, "databases to migrate")
+
+	cmd.AddCommand(newMigrateUpCmd(&opt))
+	cmd.AddCommand(newMigrateDownCmd(&opt))
+	cmd.AddCommand(newMigrateGotoCmd(&opt))
+	cmd.AddCommand(newMigrateForceCmd(&opt))
+	cmd.AddCommand(newMigrateVersionCmd(&opt))
+	return cmd
+}
+
+func newMigrateUpCmd(opt *migrateOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "up",
+		Short: "apply all pending migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrateDBs(opt, func(h *tidbHandler, db string) error {
+				return migrateUp(h, db, opt.dir, -1)
+			})
+		},
+	}
+}
+
+func newMigrateDownCmd(opt *migrateOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "down",
+		Short: "roll back all applied migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrateDBs(opt, func(h *tidbHandler, db string) error {
+				return migrateDown(h, db, opt.dir, -1)
+			})
+		},
+	}
+}
+
+func newMigrateGotoCmd(opt *migrateOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "goto <version>",
+		Short: "migrate to a specific version, up or down as needed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse target version %v error: %v", args[0], err)
+			}
+			return withMigrateDBs(opt, func(h *tidbHandler, db string) error {
+				return migrateGoto(h, db, opt.dir, target)
+			})
+		},
+	}
+}
+
+func newMigrateForceCmd(opt *migrateOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "force <version>",
+		Short: "set the migration version without running any migration, clearing the dirty flag",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse target version %v error: %v", args[0], err)
+			}
+			return withMigrateDBs(opt, func(h *tidbHandler, db string) error {
+				return setMigrationState(h, db, target, false)
+			})
+		},
+	}
+}
+
+func newMigrateVersionCmd(opt *migrateOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "print the current migration version of each database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrateDBs(opt, func(h *tidbHandler, db string) error {
+				version, dirty, err := getMigrationState(h, db)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%v: version %v, dirty: %v\n", db, version, dirty)
+				return nil
+			})
+		},
+	}
+}
+
+func withMigrateDBs(opt *migrateOptions, fn func(h *tidbHandler, db string) error) error {
+	h, err := newDBHandler(opt.dst, "")
+	if err != nil {
+		return fmt.Errorf("create destination DB handler error: %v", err)
+	}
+	if !h.dialect.SupportsMigrations() {
+		return fmt.Errorf("migrate: driver %v does not support schema migrations, only tidb/mysql are supported", opt.dst.driver)
+	}
+	for _, db := range opt.dbs {
+		if err := fn(h, db); err != nil {
+			return fmt.Errorf("migrate DB: %v error: %v", db, err)
+		}
+	}
+	return nil
+}
+
+const schemaMigrationsTable = "schema_migrations"
+
+func ensureMigrationsTable(h *tidbHandler, db string) error {
+	if !h.dialect.SupportsMigrations() {
+		return fmt.Errorf("schema_migrations bookkeeping is not supported on this dialect")
+	}
+	if _, err := h.db.Exec(fmt.Sprintf("create database if not exists `%v`", db)); err != nil {
+		return fmt.Errorf("create DB: %v error: %v", db, err)
+	}
+	if _, err := h.db.Exec("use " + db); err != nil {
+		return fmt.Errorf("switch to DB: %v error: %v", db, err)
+	}
+	createSQL := fmt.Sprintf(
+		"create table if not exists `%v` (version bigint primary key, dirty bool not null, applied_at datetime not null)",
+		schemaMigrationsTable)
+	if _, err := h.db.Exec(createSQL); err != nil {
+		return fmt.Errorf("create %v table error: %v", schemaMigrationsTable, err)
+	}
+	return nil
+}
+
+// getMigrationState returns the highest recorded version and whether it is
+// dirty, i.e. a previous migration attempt failed midway and was never
+// resolved with `force`. Version 0 with dirty=false means no migration has
+// ever been applied.
+func getMigrationState(h *tidbHandler, db string) (int64, bool, error) {
+	if err := ensureMigrationsTable(h, db); err != nil {
+		return 0, false, err
+	}
+	row := h.db.QueryRow(fmt.Sprintf("select version, dirty from `%v` order by version desc limit 1", schemaMigrationsTable))
+	var version int64
+	var dirty bool
+	switch err := row.Scan(&version, &dirty); err {
+	case nil:
+		return version, dirty, nil
+	case sql.ErrNoRows:
+		return 0, false, nil
+	default:
+		return 0, false, fmt.Errorf("query %v error: %v", schemaMigrationsTable, err)
+	}
+}
+
+func setMigrationState(h *tidbHandler, db string, version int64, dirty bool) error {
+	if err := ensureMigrationsTable(h, db); err != nil {
+		return err
+	}
+	// keep a single row, so getMigrationState's highest version is the one
+	// just set even when moving to a lower version (down, goto, force).
+	if _, err := h.db.Exec(fmt.Sprintf("delete from `%v`", schemaMigrationsTable)); err != nil {
+		return fmt.Errorf("update %v error: %v", schemaMigrationsTable, err)
+	}
+	_, err := h.db.Exec(
+		fmt.Sprintf("replace into `%v` (version, dirty, applied_at) values (?, ?, ?)", schemaMigrationsTable),
+		version, dirty, time.Now())
+	if err != nil {
+		return fmt.Errorf("update %v error: %v", schemaMigrationsTable, err)
+	}
+	return nil
+}
+
+func loadMigrations(dir, db string) ([]migration, error) {
+	migrationsByVersion := make(map[int64]*migration)
+	migDir := filepath.Join(dir, "migrations", db)
+	entries, err := ioutil.ReadDir(migDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read migrations directory %v error: %v", migDir, err)
+	}
+	for _, entry := range entries {
+		m := migrationFileRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse migration version from %v error: %v", entry.Name(), err)
+		}
+		cur, ok := migrationsByVersion[version]
+		if !ok {
+			cur = &migration{version: version, name: m[2]}
+			migrationsByVersion[version] = cur
+		}
+		fullPath := filepath.Join(migDir, entry.Name())
+		if m[3] == "up" {
+			cur.upPath = fullPath
+		} else {
+			cur.downPath = fullPath
+		}
+	}
+	migrations := make([]migration, 0, len(migrationsByVersion))
+	for _, m := range migrationsByVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+func migrateUp(h *tidbHandler, db, dir string, limit int) error {
+	migrations, err := loadMigrations(dir, db)
+	if err != nil {
+		return err
+	}
+	version, dirty, err := getMigrationState(h, db)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("DB: %v is dirty at version %v, fix it and run `force <version>` first", db, version)
+	}
+	applied := 0
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if limit >= 0 && applied >= limit {
+			break
+		}
+		if err := applyMigrationFile(h, db, m.version, m.upPath); err != nil {
+			return err
+		}
+		applied++
+	}
+	return nil
+}
+
+func migrateDown(h *tidbHandler, db, dir string, limit int) error {
+	migrations, err := loadMigrations(dir, db)
+	if err != nil {
+		return err
+	}
+	version, dirty, err := getMigrationState(h, db)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("DB: %v is dirty at version %v, fix it and run `force <version>` first", db, version)
+	}
+	applied := 0
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > version {
+			continue
+		}
+		if limit >= 0 && applied >= limit {
+			break
+		}
+		prev := int64(0)
+		if i > 0 {
+			prev = migrations[i-1].version
+		}
+		if err := applyMigrationFile(h, db, prev, m.downPath); err != nil {
+			return err
+		}
+		applied++
+	}
+	return nil
+}
+
+// migrationStep is one file to apply on the way to a goto target, and the
+// version the DB should record as current once it's applied.
+type migrationStep struct {
+	resultVersion int64
+	path          string
+}
+
+// planMigrateGoto computes the ordered steps to take db from version to
+// target: ascending .upPath files if target is ahead, descending .downPath
+// files if target is behind, filtered by migration.version so the plan
+// never overshoots target. An empty/nil result means version == target
+// already.
+func planMigrateGoto(migrations []migration, version, target int64) []migrationStep {
+	var steps []migrationStep
+	if target > version {
+		for _, m := range migrations {
+			if m.version <= version || m.version > target {
+				continue
+			}
+			steps = append(steps, migrationStep{resultVersion: m.version, path: m.upPath})
+		}
+		return steps
+	}
+	if target < version {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if m.version > version || m.version <= target {
+				continue
+			}
+			prev := target
+			if i > 0 && migrations[i-1].version > target {
+				prev = migrations[i-1].version
+			}
+			steps = append(steps, migrationStep{resultVersion: prev, path: m.downPath})
+		}
+	}
+	return steps
+}
+
+// migrateGoto migrates db to exactly version target, applying or rolling
+// back only the migrations between the current version and target. Unlike
+// migrateUp/migrateDown, whose limit only bounds how many migrations to run,
+// planMigrateGoto filters by migration.version so it never overshoots target.
+func migrateGoto(h *tidbHandler, db, dir string, target int64) error {
+	version, dirty, err := getMigrationState(h, db)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("DB: %v is dirty at version %v, fix it and run `force <version>` first", db, version)
+	}
+	migrations, err := loadMigrations(dir, db)
+	if err != nil {
+		return err
+	}
+	for _, step := range planMigrateGoto(migrations, version, target) {
+		if err := applyMigrationFile(h, db, step.resultVersion, step.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMigrationFile(h *tidbHandler, db string, resultVersion int64, path string) error {
+	if path == "" {
+		return fmt.Errorf("DB: %v has no migration file for target version %v", db, resultVersion)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read migration file %v error: %v", path, err)
+	}
+	if err := setMigrationState(h, db, resultVersion, true); err != nil {
+		return err
+	}
+	for _, stmt := range strings.Split(string(content), ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+		if _, err := h.db.Exec(stmt); err != nil {
+			return fmt.Errorf("execute migration %v statement %q error: %v, DB left dirty at version %v", path, stmt, err, resultVersion)
+		}
+	}
+	if err := setMigrationState(h, db, resultVersion, false); err != nil {
+		return err
+	}
+	fmt.Printf("applied migration %v, DB: %v now at version %v\n", path, db, resultVersion)
+	return nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import "testing"
+
+func gotoMigrations() []migration {
+	return []migration{
+		{version: 1, name: "a", upPath: "001.up.sql", downPath: "001.down.sql"},
+		{version: 2, name: "b", upPath: "002.up.sql", downPath: "002.down.sql"},
+		{version: 3, name: "c", upPath: "003.up.sql", downPath: "003.down.sql"},
+		{version: 4, name: "d", upPath: "004.up.sql", downPath: "004.down.sql"},
+		{version: 5, name: "e", upPath: "005.up.sql", downPath: "005.down.sql"},
+	}
+}
+
+func TestPlanMigrateGoto(t *testing.T) {
+	migrations := gotoMigrations()
+
+	cases := []struct {
+		name    string
+		version int64
+		target  int64
+		want    []migrationStep
+	}{
+		{
+			name:    "up stops exactly at target",
+			version: 1,
+			target:  3,
+			want: []migrationStep{
+				{resultVersion: 2, path: "002.up.sql"},
+				{resultVersion: 3, path: "003.up.sql"},
+			},
+		},
+		{
+			name:    "up to latest",
+			version: 3,
+			target:  5,
+			want: []migrationStep{
+				{resultVersion: 4, path: "004.up.sql"},
+				{resultVersion: 5, path: "005.up.sql"},
+			},
+		},
+		{
+			name:    "down stops exactly at target",
+			version: 5,
+			target:  3,
+			want: []migrationStep{
+				{resultVersion: 4, path: "005.down.sql"},
+				{resultVersion: 3, path: "004.down.sql"},
+			},
+		},
+		{
+			name:    "down to zero",
+			version: 2,
+			target:  0,
+			want: []migrationStep{
+				{resultVersion: 1, path: "002.down.sql"},
+				{resultVersion: 0, path: "001.down.sql"},
+			},
+		},
+		{
+			name:    "already at target",
+			version: 3,
+			target:  3,
+			want:    nil,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := planMigrateGoto(migrations, c.version, c.target)
+			if len(got) != len(c.want) {
+				t.Fatalf("planMigrateGoto(%v, %v) = %+v, want %+v", c.version, c.target, got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("planMigrateGoto(%v, %v)[%d] = %+v, want %+v", c.version, c.target, i, got[i], c.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// tableDiff describes how a single table's schema differs between the
+// source and destination databases captured by a migration-plan.json.
+type tableDiff struct {
+	Table   string `json:"table"`
+	Change  string `json:"change"` // added, dropped, altered
+	UpSQL   string `json:"up_sql"`
+	DownSQL string `json:"down_sql"`
+}
+
+type dbDiff struct {
+	DB     string      `json:"db"`
+	Tables []tableDiff `json:"tables"`
+}
+
+// generateMigrationPlan compares the schemas just exported from src against
+// the schemas currently present in dst and writes migration-plan.json into
+// dir, so operators can review the forward/reverse SQL before running
+// `migrate up`.
+func generateMigrationPlan(src, dst *tidbHandler, dbs []string, dir string) error {
+	plan := make([]dbDiff, 0, len(dbs))
+	for _, db := range dbs {
+		diff, err := diffDBSchemas(src, dst, db)
+		if err != nil {
+			return fmt.Errorf("diff DB: %v schemas error: %v", db, err)
+		}
+		if len(diff.Tables) == 0 {
+			continue
+		}
+		plan = append(plan, diff)
+		if err := writeMigrationFiles(dir, db, diff); err != nil {
+			return fmt.Errorf("write migration files for DB: %v error: %v", db, err)
+		}
+	}
+
+	path := filepath.Join(dir, "migration-plan.json")
+	jsonData, err := json.MarshalIndent(plan, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, jsonData, 0666); err != nil {
+		return err
+	}
+	fmt.Printf("wrote migration plan into %v\n", path)
+	return nil
+}
+
+func diffDBSchemas(src, dst *tidbHandler, db string) (dbDiff, error) {
+	srcH, closeSrcH, err := perDBHandler(src, db)
+	if err != nil {
+		return dbDiff{}, fmt.Errorf("connect to source DB: %v error: %v", db, err)
+	}
+	defer closeSrcH()
+
+	srcTables, err := getTables(srcH, db)
+	if err != nil {
+		return dbDiff{}, fmt.Errorf("get source DB: %v tables error: %v", db, err)
+	}
+	srcTableSet := make(map[string]struct{}, len(srcTables))
+	for _, t := range srcTables {
+		srcTableSet[t] = struct{}{}
+	}
+
+	dstTables := make(map[string]struct{})
+	var dstH *tidbHandler
+	if dst != nil {
+		var closeDstH func()
+		dstH, closeDstH, err = perDBHandler(dst, db)
+		if err != nil {
+			return dbDiff{}, fmt.Errorf("connect to destination DB: %v error: %v", db, err)
+		}
+		defer closeDstH()
+
+		tables, err := getTables(dstH, db)
+		if err != nil {
+			// destination database may not exist yet, in which case every
+			// source table is an addition.
+			tables = nil
+		}
+		for _, t := range tables {
+			dstTables[t] = struct{}{}
+		}
+	}
+
+	diff := dbDiff{DB: db}
+	for _, t := range srcTables {
+		createSQL, err := srcH.dialect.ShowCreateTable(srcH.db, db, t)
+		if err != nil {
+			return dbDiff{}, err
+		}
+		if _, ok := dstTables[t]; !ok {
+			diff.Tables = append(diff.Tables, tableDiff{
+				Table:   t,
+				Change:  "added",
+				UpSQL:   createSQL,
+				DownSQL: fmt.Sprintf("drop table if exists `%v`.`%v`;", db, t),
+			})
+			continue
+		}
+		dstCreateSQL, err := dstH.dialect.ShowCreateTable(dstH.db, db, t)
+		if err != nil {
+			return dbDiff{}, err
+		}
+		if createSQL == dstCreateSQL {
+			continue
+		}
+		upSQL, err := diffCreateTableAlterSQL(db, t, dstCreateSQL, createSQL)
+		if err != nil {
+			return dbDiff{}, err
+		}
+		downSQL, err := diffCreateTableAlterSQL(db, t, createSQL, dstCreateSQL)
+		if err != nil {
+			return dbDiff{}, err
+		}
+		diff.Tables = append(diff.Tables, tableDiff{
+			Table:   t,
+			Change:  "altered",
+			UpSQL:   upSQL,
+			DownSQL: downSQL,
+		})
+	}
+	for t := range dstTables {
+		if _, ok := srcTableSet[t]; ok {
+			continue
+		}
+		dstCreateSQL, err := dstH.dialect.ShowCreateTable(dstH.db, db, t)
+		if err != nil {
+			return dbDiff{}, err
+		}
+		diff.Tables = append(diff.Tables, tableDiff{
+			Table:   t,
+			Change:  "dropped",
+			UpSQL:   fmt.Sprintf("drop table if exists `%v`.`%v`;", db, t),
+			DownSQL: dstCreateSQL,
+		})
+	}
+	return diff, nil
+}
+
+func writeMigrationFiles(dir, db string, diff dbDiff) error {
+	migDir := filepath.Join(dir, "migrations", db)
+	if err := os.MkdirAll(migDir, 0776); err != nil {
+		return err
+	}
+	existing, err := loadMigrations(dir, db)
+	if err != nil {
+		return err
+	}
+	nextVersion := int64(1)
+	if len(existing) > 0 {
+		nextVersion = existing[len(existing)-1].version + 1
+	}
+	for _, t := range diff.Tables {
+		upPath := filepath.Join(migDir, fmt.Sprintf("%03d_%v_%v.up.sql", nextVersion, diff.DB, t.Table))
+		downPath := filepath.Join(migDir, fmt.Sprintf("%03d_%v_%v.down.sql", nextVersion, diff.DB, t.Table))
+		if err := ioutil.WriteFile(upPath, []byte(t.UpSQL), 0666); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(downPath, []byte(t.DownSQL), 0666); err != nil {
+			return err
+		}
+		nextVersion++
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// progress tracks how many of a known total number of tables have been
+// processed, and how many bytes have been transferred, so long-running
+// parallel exports/imports can print a tables-done/total, bytes and ETA line
+// as each table finishes.
+type progress struct {
+	label     string
+	total     int64
+	done      int64
+	bytes     int64
+	startedAt time.Time
+}
+
+func newProgress(label string, total int) *progress {
+	return &progress{label: label, total: int64(total), startedAt: time.Now()}
+}
+
+func (p *progress) addBytes(n int64) {
+	atomic.AddInt64(&p.bytes, n)
+}
+
+// tick marks one more table done and prints a progress line with an ETA
+// extrapolated from the average time-per-table seen so far.
+func (p *progress) tick() {
+	done := atomic.AddInt64(&p.done, 1)
+	elapsed := time.Since(p.startedAt)
+	eta := time.Duration(0)
+	if done > 0 {
+		eta = time.Duration(int64(elapsed) / done * (p.total - done))
+	}
+	fmt.Printf("%v: %v/%v tables done, %v bytes downloaded, eta %v\n",
+		p.label, done, p.total, atomic.LoadInt64(&p.bytes), eta.Round(time.Second))
+}
+
+// runParallel runs fn(items[i]) for every item, with at most parallel
+// goroutines in flight at once. The first error cancels the shared context
+// so in-flight and not-yet-started work can abort promptly, and that first
+// error is returned once every goroutine has stopped.
+func runParallel(parallel int, items []string, fn func(ctx context.Context, item string) error) error {
+	if parallel <= 0 {
+		parallel = 1
+	}
+	group, ctx := errgroup.WithContext(context.Background())
+	sem := make(chan struct{}, parallel)
+	for _, item := range items {
+		item := item
+		sem <- struct{}{}
+		group.Go(func() error {
+			defer func() { <-sem }()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			return fn(ctx, item)
+		})
+	}
+	return group.Wait()
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -18,37 +20,64 @@ import (
 	"github.com/spf13/cobra"
 )
 
-type tidbAccessOptions struct {
-	addr       string
-	statusPort string
-	port       string
-	user       string
-	password   string
-	version    string
+// statsHTTPClient is shared across exportTableStats calls so a `--parallel`
+// export reuses keep-alive connections to the source's status port instead
+// of establishing a new one per table.
+var statsHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		MaxIdleConns:        64,
+		MaxIdleConnsPerHost: 64,
+		IdleConnTimeout:     90 * time.Second,
+	},
 }
 
 type tidbHandler struct {
-	opt tidbAccessOptions
-	db  *sql.DB
+	opt     tidbAccessOptions
+	db      *sql.DB
+	dialect Dialect
 }
 
 func newDBHandler(opt tidbAccessOptions, defaultDB string) (*tidbHandler, error) {
-	defaultDB = strings.TrimSpace(strings.ToLower(defaultDB))
-	if defaultDB == "" {
-		defaultDB = "mysql"
+	dialect, err := dialectForDriver(opt.driver)
+	if err != nil {
+		return nil, err
 	}
-	dns := fmt.Sprintf("%s:%s@tcp(%s:%s)/%v", opt.user, opt.password, opt.addr, opt.port, defaultDB)
-	if opt.password == "" {
-		dns = fmt.Sprintf("%s@tcp(%s:%s)/%v", opt.user, opt.addr, opt.port, defaultDB)
+
+	driverName, dsn := "mysql", ""
+	if _, ok := dialect.(postgresDialect); ok {
+		driverName = "postgres"
+		dsn = buildPostgresDSN(opt, defaultDB)
+	} else {
+		dsn, err = buildDSN(opt, defaultDB)
+		if err != nil {
+			return nil, err
+		}
 	}
-	db, err := sql.Open("mysql", dns)
+
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
-		return nil, fmt.Errorf("connect to database dns:%v, error: %v", dns, err)
+		return nil, fmt.Errorf("connect to database dsn:%v, error: %v", dsn, err)
 	}
 	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("ping DB %v error: %v", dns, err)
+		return nil, fmt.Errorf("ping DB %v error: %v", dsn, err)
+	}
+	return &tidbHandler{opt, db, dialect}, nil
+}
+
+// perDBHandler returns a handler connected to dbName and a closer to release
+// it when the caller is done. MySQL/TiDB namespace tables by database on a
+// single connection via `use`, so h is reused as-is. Postgres and
+// CockroachDB have no `use`: each database is a distinct DSN, so a dedicated
+// connection is opened and must be closed once the caller finishes with it.
+func perDBHandler(h *tidbHandler, dbName string) (*tidbHandler, func(), error) {
+	if _, ok := h.dialect.(postgresDialect); !ok {
+		return h, func() {}, nil
 	}
-	return &tidbHandler{opt, db}, nil
+	dh, err := newDBHandler(h.opt, dbName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to DB: %v error: %v", dbName, err)
+	}
+	return dh, func() { dh.db.Close() }, nil
 }
 
 type transportOptions struct {
@@ -58,6 +87,10 @@ type transportOptions struct {
 	dbs          []string
 	tables       []string
 	ignoreTables []string
+	parallel     int
+	force        bool
+	verifyOnly   bool
+	metricsAddr  string
 }
 
 func newTransportCmd() *cobra.Command {
@@ -73,6 +106,16 @@ func newTransportCmd() *cobra.Command {
 			if err := os.MkdirAll(opt.dir, 0776); err != nil {
 				return fmt.Errorf("create destination directory error: %v", err)
 			}
+
+			metrics := newTransportMetrics()
+			if opt.metricsAddr != "" {
+				server, err := startMetricsServer(opt.metricsAddr, metrics)
+				if err != nil {
+					return fmt.Errorf("start metrics server error: %v", err)
+				}
+				defer stopMetricsServer(server)
+			}
+
 			if opt.src.addr != "" {
 				fmt.Println("begin to export schemas and statistics information from source databases")
 				src, err := newDBHandler(opt.src, "")
@@ -82,19 +125,41 @@ func newTransportCmd() *cobra.Command {
 
 				tablesMap := make(map[string]struct{})
 				for _, t := range opt.tables {
-					tablesMap[t] = struct{}{}
+					tablesMap[strings.ToLower(t)] = struct{}{}
 				}
 				ignoreTablesMap := make(map[string]struct{})
 				for _, t := range opt.ignoreTables {
-					ignoreTablesMap[t] = struct{}{}
+					ignoreTablesMap[strings.ToLower(t)] = struct{}{}
 				}
-				if err = exportSchemas(src, opt.dbs, opt.dir, tablesMap, ignoreTablesMap); err != nil {
+
+				if opt.verifyOnly {
+					return verifyDirAgainstSource(src, opt.dbs, opt.dir, tablesMap, ignoreTablesMap)
+				}
+
+				m, err := loadManifest(opt.dir)
+				if err != nil {
+					return fmt.Errorf("load manifest error: %v", err)
+				}
+				if err = exportSchemas(src, opt.dbs, opt.dir, tablesMap, ignoreTablesMap, opt.parallel, m, opt.force, metrics); err != nil {
 					return fmt.Errorf("export schemas error: %v", err)
 				}
-				if err = exportStats(src, opt.dbs, opt.dir, tablesMap, ignoreTablesMap); err != nil {
+				if err = exportStats(src, opt.dbs, opt.dir, tablesMap, ignoreTablesMap, opt.parallel, m, opt.force, metrics); err != nil {
 					return fmt.Errorf("export statistics information error: %v", err)
 				}
+				if err := m.save(opt.dir); err != nil {
+					return fmt.Errorf("save manifest error: %v", err)
+				}
 				fmt.Println("export schemas and statistics information from source databases successfully")
+
+				if opt.dst.addr != "" {
+					dst, err := newDBHandler(opt.dst, "")
+					if err != nil {
+						return fmt.Errorf("create destination DB handler error: %v", err)
+					}
+					if err := generateMigrationPlan(src, dst, opt.dbs, opt.dir); err != nil {
+						return fmt.Errorf("generate migration plan error: %v", err)
+					}
+				}
 			}
 			if opt.dst.addr != "" {
 				fmt.Println("begin to import schemas and statistics information into destination databases")
@@ -102,10 +167,10 @@ func newTransportCmd() *cobra.Command {
 				if err != nil {
 					return fmt.Errorf("create destination DB handler error: %v", err)
 				}
-				if err = importSchemas(dst, opt.dbs, opt.dir); err != nil {
+				if err = importSchemas(dst, opt.dbs, opt.dir, opt.parallel, metrics); err != nil {
 					return fmt.Errorf("import schemas error: %v", err)
 				}
-				if err = importStats(dst, opt.dbs, opt.dir); err != nil {
+				if err = importStats(dst, opt.dbs, opt.dir, opt.parallel, metrics); err != nil {
 					return fmt.Errorf("import statistics information error: %v", err)
 				}
 				fmt.Println("import schemas and statistics information into destination databases successfully")
@@ -123,29 +188,41 @@ func newTransportCmd() *cobra.Command {
 	cmd.Flags().StringVar(&opt.dst.statusPort, "dststatusport", "10080", "")
 	cmd.Flags().StringVar(&opt.dst.user, "dstuser", "", "")
 	cmd.Flags().StringVar(&opt.dst.password, "dstpassword", "", "")
+	registerAccessFlags(cmd, &opt.src, "src")
+	registerAccessFlags(cmd, &opt.dst, "dst")
 	cmd.Flags().StringVar(&opt.dir, "dir", "", "destination directory to store exported schemas and statistics")
 	cmd.Flags().StringSliceVar(&opt.dbs, "dbs", nil, "databases to export or import")
 	cmd.Flags().StringSliceVar(&opt.tables, "tables", nil, "tables to export, if nil export all tables")
 	cmd.Flags().StringSliceVar(&opt.ignoreTables, "ignore-tables", nil, "tables to ignore when exporting")
+	cmd.Flags().IntVar(&opt.parallel, "parallel", 1, "number of tables to export/import concurrently")
+	cmd.Flags().BoolVar(&opt.force, "force", false, "re-export tables even if the manifest says they are already up to date; import does not use it")
+	cmd.Flags().BoolVar(&opt.verifyOnly, "verify-only", false, "only check --dir against the live source, without exporting")
+	cmd.Flags().StringVar(&opt.metricsAddr, "metrics-addr", "", "if set, serve Prometheus metrics on /metrics and JSON status on /status at this address, e.g. :9090")
 	return cmd
 }
 
-func exportSchemas(h *tidbHandler, dbs []string, dir string, tablesMap, ignoreTables map[string]struct{}) error {
+func exportSchemas(h *tidbHandler, dbs []string, dir string, tablesMap, ignoreTables map[string]struct{}, parallel int, m *manifestFile, force bool, metrics *transportMetrics) error {
 	for _, db := range dbs {
-		if err := exportDBSchemas(h, db, dir, tablesMap, ignoreTables); err != nil {
+		if err := exportDBSchemas(h, db, dir, tablesMap, ignoreTables, parallel, m, force, metrics); err != nil {
 			return fmt.Errorf("export DB: %v schemas to %v error: %v", db, dir, err)
 		}
 	}
 	return nil
 }
 
-func exportDBSchemas(h *tidbHandler, db, dir string, tablesMap, ignoreTables map[string]struct{}) error {
+func exportDBSchemas(h *tidbHandler, db, dir string, tablesMap, ignoreTables map[string]struct{}, parallel int, m *manifestFile, force bool, metrics *transportMetrics) error {
+	h, closeH, err := perDBHandler(h, db)
+	if err != nil {
+		return err
+	}
+	defer closeH()
+
 	tables, err := getTables(h, db)
 	if err != nil {
 		return fmt.Errorf("get DB: %v table information error: %v", db, err)
 	}
-	path := filepath.Join(dir, fmt.Sprintf("schema-%v.sql", db))
-	tableSchemas := make(map[string]string)
+
+	wanted := make([]string, 0, len(tables))
 	for _, t := range tables {
 		if _, ok := ignoreTables[strings.ToLower(t)]; ok {
 			fmt.Printf("ignore table: %v\n", t)
@@ -156,22 +233,49 @@ func exportDBSchemas(h *tidbHandler, db, dir string, tablesMap, ignoreTables map
 				continue
 			}
 		}
+		wanted = append(wanted, t)
+	}
 
-		showSQL := fmt.Sprintf("show create table `%v`.`%v`", db, t)
-		rows, err := h.db.Query(showSQL)
-		if err != nil {
-			return fmt.Errorf("exec SQL: %v error: %v", showSQL, err)
-		}
-		rows.Next()
-		var table, createSQL string
-		if err := rows.Scan(&table, &createSQL); err != nil {
-			rows.Close()
-			return fmt.Errorf("scan rows error: %v", err)
-		}
-		tableSchemas[table] = createSQL
-		if err := rows.Close(); err != nil {
-			return err
+	path := filepath.Join(dir, fmt.Sprintf("schema-%v.sql", db))
+	existingSchemas := make(map[string]string)
+	if content, err := ioutil.ReadFile(path); err == nil {
+		_ = json.Unmarshal(content, &existingSchemas)
+	}
+
+	var mu sync.Mutex
+	tableSchemas := make(map[string]string, len(wanted))
+	prog := newProgress(fmt.Sprintf("export %v schemas", db), len(wanted))
+	err = runParallel(parallel, wanted, func(ctx context.Context, t string) error {
+		if !force {
+			if entry, ok := m.get(db, t); ok {
+				if cached, ok := existingSchemas[t]; ok && sha256Hex([]byte(cached)) == entry.SchemaSHA256 {
+					mu.Lock()
+					tableSchemas[t] = cached
+					mu.Unlock()
+					prog.tick()
+					return nil
+				}
+			}
 		}
+
+		return metrics.observeTable("export_schema", db, t, func() error {
+			createSQL, err := h.dialect.ShowCreateTable(h.db, db, t)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			tableSchemas[t] = createSQL
+			mu.Unlock()
+			m.update(db, t, func(e *manifestEntry) {
+				e.Addr = h.opt.addr
+				e.SchemaSHA256 = sha256Hex([]byte(createSQL))
+			})
+			prog.tick()
+			return nil
+		})
+	})
+	if err != nil {
+		return err
 	}
 
 	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
@@ -193,12 +297,14 @@ func exportDBSchemas(h *tidbHandler, db, dir string, tablesMap, ignoreTables map
 	return nil
 }
 
-func exportStats(h *tidbHandler, dbs []string, dir string, tablesMap, ignoreTables map[string]struct{}) error {
+func exportStats(h *tidbHandler, dbs []string, dir string, tablesMap, ignoreTables map[string]struct{}, parallel int, m *manifestFile, force bool, metrics *transportMetrics) error {
 	for _, db := range dbs {
 		tables, err := getTables(h, db)
 		if err != nil {
 			return fmt.Errorf("get DB: %v table information error: %v", db, err)
 		}
+
+		wanted := make([]string, 0, len(tables))
 		for _, t := range tables {
 			if _, ok := ignoreTables[strings.ToLower(t)]; ok {
 				fmt.Printf("ignore table: %v\n", t)
@@ -209,102 +315,209 @@ func exportStats(h *tidbHandler, dbs []string, dir string, tablesMap, ignoreTabl
 					continue
 				}
 			}
-			if err := exportTableStats(h, db, t, dir); err != nil {
-				return fmt.Errorf("export DB: %v table: %v statistics to %v error: %v", db, t, dir, err)
+			wanted = append(wanted, t)
+		}
+
+		prog := newProgress(fmt.Sprintf("export %v stats", db), len(wanted))
+		err = runParallel(parallel, wanted, func(ctx context.Context, t string) error {
+			if !force {
+				if entry, ok := m.get(db, t); ok && entry.StatsSHA256 != "" {
+					if hash, err := sha256File(statsPath(db, t, dir)); err == nil && hash == entry.StatsSHA256 {
+						prog.addBytes(entry.StatsBytes)
+						prog.tick()
+						return nil
+					}
+				}
 			}
+
+			return metrics.observeTable("export_stats", db, t, func() error {
+				n, hash, err := exportTableStats(ctx, h, db, t, dir)
+				if err != nil {
+					return fmt.Errorf("export DB: %v table: %v statistics to %v error: %v", db, t, dir, err)
+				}
+				m.update(db, t, func(e *manifestEntry) {
+					e.Addr = h.opt.addr
+					e.StatsSHA256 = hash
+					e.StatsBytes = n
+				})
+				metrics.statsDumpBytes.Observe(float64(n))
+				prog.addBytes(n)
+				prog.tick()
+				return nil
+			})
+		})
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func exportTableStats(h *tidbHandler, db, table, dir string) error {
+func exportTableStats(ctx context.Context, h *tidbHandler, db, table, dir string) (int64, string, error) {
 	addr := fmt.Sprintf("http://%v:%v/stats/dump/%v/%v", h.opt.addr, h.opt.statusPort, db, table)
-	resp, err := http.Get(addr)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
 	if err != nil {
-		return fmt.Errorf("request URL: %v error: %v", addr, err)
+		return 0, "", fmt.Errorf("build request URL: %v error: %v", addr, err)
 	}
-	path := filepath.Join(dir, fmt.Sprintf("stats-%v-%v.json", db, table))
+	resp, err := statsHTTPClient.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("request URL: %v error: %v", addr, err)
+	}
+	defer resp.Body.Close()
+	path := statsPath(db, table, dir)
 	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
 	defer file.Close()
 	buf := bufio.NewWriter(file)
-	if _, err := io.Copy(buf, resp.Body); err != nil {
-		return err
+	n, err := io.Copy(buf, resp.Body)
+	if err != nil {
+		return n, "", err
 	}
 	if err := buf.Flush(); err != nil {
-		return err
+		return n, "", err
+	}
+	hash, err := sha256File(path)
+	if err != nil {
+		return n, "", err
 	}
 	fmt.Printf("export %v:%v/%v.%v stats into %v\n", h.opt.addr, h.opt.port, db, table, path)
-	return nil
+	return n, hash, nil
 }
 
-func importSchemas(h *tidbHandler, dbs []string, dir string) error {
+func importSchemas(h *tidbHandler, dbs []string, dir string, parallel int, metrics *transportMetrics) error {
+	m, err := loadManifest(dir)
+	if err != nil {
+		return fmt.Errorf("load manifest error: %v", err)
+	}
 	for _, db := range dbs {
-		if _, err := h.db.Exec(fmt.Sprintf("create database if not exists `%v`", db)); err != nil {
-			return fmt.Errorf("create DB: %v error: %v", db, err)
-		}
-		if _, err := h.db.Exec("use " + db); err != nil {
-			return fmt.Errorf("switch to DB: %v error: %v", db, err)
+		if err := importDBSchemas(h, db, dir, m, parallel, metrics); err != nil {
+			return err
 		}
-		path := filepath.Join(dir, fmt.Sprintf("schema-%v.sql", db))
-		content, err := ioutil.ReadFile(path)
+	}
+	return nil
+}
+
+func importDBSchemas(h *tidbHandler, db, dir string, m *manifestFile, parallel int, metrics *transportMetrics) error {
+	if err := h.dialect.CreateDatabaseIfNotExists(h.db, db); err != nil {
+		return err
+	}
+	dh, closeDH, err := perDBHandler(h, db)
+	if err != nil {
+		return err
+	}
+	defer closeDH()
+
+	// getMigrationState's schema_migrations bookkeeping is MySQL/TiDB-only
+	// (see Dialect.SupportsMigrations); dialects without it simply have no
+	// dirty state to check.
+	if dh.dialect.SupportsMigrations() {
+		_, dirty, err := getMigrationState(dh, db)
 		if err != nil {
-			return fmt.Errorf("read file %v err: %v", path, err)
+			return err
 		}
-		tableSchemas := make(map[string]string)
-		if err := json.Unmarshal(content, &tableSchemas); err != nil {
-			return fmt.Errorf("unmarshal file %v err: %v", path, err)
+		if dirty {
+			return fmt.Errorf("DB: %v is dirty, fix it and run `migrate force <version>` before importing again", db)
 		}
+	}
 
-		for _, sql := range tableSchemas {
-			sql = strings.TrimSpace(sql)
-			if _, err := h.db.Exec(sql); err != nil {
+	path := filepath.Join(dir, fmt.Sprintf("schema-%v.sql", db))
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read file %v err: %v", path, err)
+	}
+	tableSchemas := make(map[string]string)
+	if err := json.Unmarshal(content, &tableSchemas); err != nil {
+		return fmt.Errorf("unmarshal file %v err: %v", path, err)
+	}
+	for table, ddl := range tableSchemas {
+		if entry, ok := m.get(db, table); ok && entry.SchemaSHA256 != "" && sha256Hex([]byte(ddl)) != entry.SchemaSHA256 {
+			return fmt.Errorf("schema for %v.%v in %v does not match manifest, refusing to import a possibly corrupt file", db, table, path)
+		}
+	}
+
+	existingTables, err := dh.dialect.ListTables(dh.db, db)
+	if err != nil {
+		return err
+	}
+	existing := stringSliceToMap(existingTables)
+
+	tables := make([]string, 0, len(tableSchemas))
+	for table := range tableSchemas {
+		tables = append(tables, table)
+	}
+	err = runParallel(parallel, tables, func(ctx context.Context, table string) error {
+		return metrics.observeTable("import_schema", db, table, func() error {
+			if _, ok := existing[table]; ok {
+				fmt.Printf("table %v.%v already exists, skip\n", db, table)
+				return nil
+			}
+			sql, err := dh.dialect.TranslateCreateTable(db, strings.TrimSpace(tableSchemas[table]))
+			if err != nil {
+				return fmt.Errorf("translate schema for table %v.%v error: %v", db, table, err)
+			}
+			if _, err := dh.db.Exec(sql); err != nil {
 				return fmt.Errorf("execute SQL: %v from %v error: %v", sql, path, err)
 			}
-		}
-		fmt.Printf("import schemas from %v into %v:%v/%v\n", path, h.opt.addr, h.opt.port, db)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
 	}
+	fmt.Printf("import schemas from %v into %v:%v/%v\n", path, dh.opt.addr, dh.opt.port, db)
 	return nil
 }
 
-func importStats(h *tidbHandler, dbs []string, dir string) error {
+func importStats(h *tidbHandler, dbs []string, dir string, parallel int, metrics *transportMetrics) error {
+	m, err := loadManifest(dir)
+	if err != nil {
+		return fmt.Errorf("load manifest error: %v", err)
+	}
 	for _, db := range dbs {
 		files, err := filepath.Glob(filepath.Join(dir, "stats-"+db+"-*[.]json"))
 		if err != nil {
 			return err
 		}
-		for _, fpath := range files {
-			mysql.RegisterLocalFile(fpath)
-			if _, err := h.db.Exec(fmt.Sprintf("load stats '%v'", fpath)); err != nil {
-				return err
-			}
-			fmt.Printf("import stats from %v into %v:%v/%v\n", fpath, h.opt.addr, h.opt.port, db)
+		err = runParallel(parallel, files, func(ctx context.Context, fpath string) error {
+			table := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(fpath), "stats-"+db+"-"), ".json")
+			return metrics.observeTable("import_stats", db, table, func() error {
+				content, err := ioutil.ReadFile(fpath)
+				if err != nil {
+					return fmt.Errorf("read stats file %v error: %v", fpath, err)
+				}
+				if !json.Valid(content) {
+					return fmt.Errorf("stats file %v is not valid JSON, refusing to import a truncated/corrupt file", fpath)
+				}
+				if entry, ok := m.get(db, table); ok && entry.StatsSHA256 != "" && sha256Hex(content) != entry.StatsSHA256 {
+					return fmt.Errorf("stats file %v does not match manifest, refusing to import a possibly corrupt file", fpath)
+				}
+
+				if err := h.dialect.LoadStats(h, db, table, fpath); err != nil {
+					return err
+				}
+				fmt.Printf("import stats from %v into %v:%v/%v\n", fpath, h.opt.addr, h.opt.port, db)
+				return nil
+			})
+		})
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func getTables(h *tidbHandler, db string) ([]string, error) {
-	_, err := h.db.Exec("use " + db)
-	if err != nil {
-		return nil, fmt.Errorf("switch to DB: %v error: %v", db, err)
-	}
-	rows, err := h.db.Query("show tables")
-	if err != nil {
-		return nil, fmt.Errorf("execute show tables error: %v", err)
-	}
-	defer rows.Close()
-	tables := make([]string, 0, 8)
-	for rows.Next() {
-		var table string
-		if err := rows.Scan(&table); err != nil {
-			return nil, fmt.Errorf("scan rows error: %v", err)
-		}
-		tables = append(tables, table)
+func loadStatsFile(h *tidbHandler, path string) error {
+	mysql.RegisterLocalFile(path)
+	if _, err := h.db.Exec(fmt.Sprintf("load stats '%v'", path)); err != nil {
+		return err
 	}
-	return tables, nil
+	return nil
+}
+
+func getTables(h *tidbHandler, db string) ([]string, error) {
+	return h.dialect.ListTables(h.db, db)
 }
 
 func tmpPathDir() string {
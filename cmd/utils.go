@@ -1,16 +1,18 @@
 package cmd
 
 import (
-	"database/sql"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/pingcap/tiup/pkg/localdata"
-	"github.com/qw4990/plan-change-capturer/instance"
+	"github.com/go-sql-driver/mysql"
+	"github.com/spf13/cobra"
 )
 
 func compareVer(ver1, ver2 string) int {
@@ -29,104 +31,116 @@ type tidbAccessOptions struct {
 	user       string
 	password   string
 	version    string
-}
 
-type tidbHandler struct {
-	opt tidbAccessOptions
-	db  *sql.DB
-	p   *localdata.Process
+	dsn         string
+	connTimeout time.Duration
+	tls         string
+	tlsCA       string
+	tlsCert     string
+	tlsKey      string
+	driver      string
 }
 
-func (db *tidbHandler) getDBs() ([]string, error) {
-	rows, err := db.db.Query("show databases")
-	if err != nil {
-		return nil, fmt.Errorf("execute show databases error: %v", err)
+const defaultConnTimeout = 30 * time.Second
+
+// buildDSN turns a tidbAccessOptions into a DSN understood by
+// github.com/go-sql-driver/mysql. If opt.dsn is set it is used as-is so
+// callers can point at deployments (e.g. TiDB Cloud) that need DSN options
+// this tool doesn't expose its own flags for. Otherwise a mysql.Config is
+// assembled from the individual flags, with connection timeouts and TLS
+// registered as requested.
+func buildDSN(opt tidbAccessOptions, defaultDB string) (string, error) {
+	if opt.dsn != "" {
+		return opt.dsn, nil
 	}
-	defer rows.Close()
-	dbs := make([]string, 0, 8)
-	for rows.Next() {
-		var dbName string
-		if err := rows.Scan(&dbName); err != nil {
-			return nil, fmt.Errorf("scan rows err: %v", err)
-		}
-		if !isSysDB(dbName) {
-			dbs = append(dbs, dbName)
-		}
-	}
-	return dbs, nil
-}
 
-func (db *tidbHandler) getTables(dbName string) ([]string, error) {
-	_, err := db.db.Exec("use " + dbName)
-	if err != nil {
-		return nil, fmt.Errorf("switch to DB: %v error: %v", db, err)
+	defaultDB = strings.TrimSpace(strings.ToLower(defaultDB))
+	if defaultDB == "" {
+		defaultDB = "mysql"
 	}
-	rows, err := db.db.Query("show tables")
-	if err != nil {
-		return nil, fmt.Errorf("execute show tables error: %v", err)
+	timeout := opt.connTimeout
+	if timeout == 0 {
+		timeout = defaultConnTimeout
 	}
-	defer rows.Close()
-	tables := make([]string, 0, 8)
-	for rows.Next() {
-		var table string
-		if err := rows.Scan(&table); err != nil {
-			return nil, fmt.Errorf("scan rows error: %v", err)
-		}
-		tables = append(tables, table)
+	cfg := mysql.NewConfig()
+	cfg.User = opt.user
+	cfg.Passwd = opt.password
+	cfg.Net = "tcp"
+	cfg.Addr = fmt.Sprintf("%s:%s", opt.addr, opt.port)
+	cfg.DBName = defaultDB
+	cfg.Timeout = timeout
+	cfg.ReadTimeout = timeout
+	cfg.WriteTimeout = timeout
+	cfg.ParseTime = true
+
+	tlsConfigName, err := registerTLSConfig(opt)
+	if err != nil {
+		return "", err
 	}
-	return tables, nil
-}
+	cfg.TLSConfig = tlsConfigName
 
-func (db *tidbHandler) execute(sqls ...string) error {
-	for _, sql := range sqls {
-		if _, err := db.db.Exec(sql); err != nil {
-			return fmt.Errorf("execute `%v` error: %v", sql, err)
-		}
-	}
-	return nil
+	return cfg.FormatDSN(), nil
 }
 
-func startAndConnectDB(opt tidbAccessOptions, defaultDB string) (*tidbHandler, error) {
-	if opt.version == "" {
-		return nil, fmt.Errorf("no TiDB version")
-	}
-	p, port, status := instance.StartTiDB(opt.version)
-	opt.port = fmt.Sprintf("%v", port)
-	opt.statusPort = fmt.Sprintf("%v", status)
-	opt.user = "root"
-	opt.password = ""
-	opt.addr = "127.0.0.1"
-	db, err := connectDB(opt, defaultDB)
-	if err != nil {
-		return nil, err
+// registerTLSConfig maps --tls and --tls-ca/--tls-cert/--tls-key onto the
+// driver's TLSConfig DSN parameter, registering a custom *tls.Config via
+// mysql.RegisterTLSConfig when a CA/cert/key is supplied.
+func registerTLSConfig(opt tidbAccessOptions) (string, error) {
+	if opt.tlsCA == "" && opt.tlsCert == "" && opt.tlsKey == "" {
+		switch opt.tls {
+		case "", "false":
+			return "", nil
+		case "required":
+			// the driver spells "verify the server certificate" as "true".
+			return "true", nil
+		case "preferred", "skip-verify", "true":
+			return opt.tls, nil
+		default:
+			// a previously registered custom config name.
+			return opt.tls, nil
+		}
 	}
-	db.p = p
-	return db, nil
-}
 
-func connectDB(opt tidbAccessOptions, defaultDB string) (*tidbHandler, error) {
-	defaultDB = strings.TrimSpace(strings.ToLower(defaultDB))
-	if defaultDB == "" {
-		defaultDB = "mysql"
+	tlsConfig := &tls.Config{}
+	if opt.tlsCA != "" {
+		pem, err := ioutil.ReadFile(opt.tlsCA)
+		if err != nil {
+			return "", fmt.Errorf("read tls-ca %v error: %v", opt.tlsCA, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("append tls-ca %v to cert pool failed", opt.tlsCA)
+		}
+		tlsConfig.RootCAs = pool
 	}
-	dns := fmt.Sprintf("%s:%s@tcp(%s:%s)/%v", opt.user, opt.password, opt.addr, opt.port, defaultDB)
-	if opt.password == "" {
-		dns = fmt.Sprintf("%s@tcp(%s:%s)/%v", opt.user, opt.addr, opt.port, defaultDB)
+	if opt.tlsCert != "" || opt.tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(opt.tlsCert, opt.tlsKey)
+		if err != nil {
+			return "", fmt.Errorf("load tls-cert %v / tls-key %v error: %v", opt.tlsCert, opt.tlsKey, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
-	db, err := sql.Open("mysql", dns)
-	if err != nil {
-		return nil, fmt.Errorf("connect to database dns:%v, error: %v", dns, err)
+	if opt.tls == "skip-verify" {
+		tlsConfig.InsecureSkipVerify = true
 	}
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("ping DB %v error: %v", dns, err)
+
+	const customTLSConfigName = "plan-change-capturer-custom"
+	if err := mysql.RegisterTLSConfig(customTLSConfigName, tlsConfig); err != nil {
+		return "", fmt.Errorf("register tls config error: %v", err)
 	}
-	return &tidbHandler{opt, db, nil}, nil
+	return customTLSConfigName, nil
 }
 
-func tmpPathDir() string {
-	t := time.Now().Format(time.RFC3339)
-	t = strings.ReplaceAll(t, ":", "-")
-	return filepath.Join(os.TempDir(), "plan-change-capturer", t)
+// registerAccessFlags adds the --<prefix>dsn/--<prefix>tls* flags shared by
+// every command that dials a database via tidbAccessOptions.
+func registerAccessFlags(cmd *cobra.Command, opt *tidbAccessOptions, prefix string) {
+	cmd.Flags().StringVar(&opt.dsn, prefix+"dsn", "", "full DSN, overrides the other "+prefix+"* connection flags")
+	cmd.Flags().DurationVar(&opt.connTimeout, prefix+"conn-timeout", defaultConnTimeout, "dial/read/write timeout")
+	cmd.Flags().StringVar(&opt.tls, prefix+"tls", "", "TLS mode: preferred, required, skip-verify, or a custom config name")
+	cmd.Flags().StringVar(&opt.tlsCA, prefix+"tls-ca", "", "path to the TLS CA certificate")
+	cmd.Flags().StringVar(&opt.tlsCert, prefix+"tls-cert", "", "path to the TLS client certificate")
+	cmd.Flags().StringVar(&opt.tlsKey, prefix+"tls-key", "", "path to the TLS client key")
+	cmd.Flags().StringVar(&opt.driver, prefix+"driver", "tidb", "database driver: tidb, mysql or postgres")
 }
 
 var sysDBs = []string{"INFORMATION_SCHEMA", "METRICS_SCHEMA", "PERFORMANCE_SCHEMA", "mysql"}